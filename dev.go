@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer : メールを送信する代わりに、1通ごとに .eml ファイルとしてディレクトリへ書き出す
+// ローカル開発時など、実際には送信したくない場合にMailerの差し替え先として使用する
+type FileMailer struct {
+	Dir string // 書き出し先ディレクトリ
+}
+
+// Ping : 書き出し先ディレクトリの存在確認
+func (f *FileMailer) Ping(timeout int) error {
+	info, err := os.Stat(f.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", f.Dir)
+	}
+	return nil
+}
+
+// Send : メールを .eml ファイルとして書き出す
+func (f *FileMailer) Send(m *Mail) error {
+	if m == nil {
+		return fmt.Errorf("not mail object")
+	}
+
+	header, err := m.Header()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(f.Dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	return ioutil.WriteFile(path, []byte(header), 0644)
+}
+
+// LogMailer : メールを送信する代わりに、指定したWriterへそのまま書き出す
+// テストや開発時に、送信内容をログや標準出力で確認したい場合に使用する
+type LogMailer struct {
+	Writer io.Writer
+}
+
+// Ping : 送信先を持たないため、常に疎通成功を返す
+func (l *LogMailer) Ping(timeout int) error {
+	return nil
+}
+
+// Send : メール内容をWriterへ書き出す
+func (l *LogMailer) Send(m *Mail) error {
+	if m == nil {
+		return fmt.Errorf("not mail object")
+	}
+
+	header, err := m.Header()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(l.Writer, header)
+	return err
+}
@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	f := &FileMailer{Dir: dir}
+
+	if err := f.Ping(1000); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	m := &Mail{From: "sender@example.com", To: []string{"to@example.com"}, Subject: "hi", Body: "hello"}
+	if err := f.Send(m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly 1 .eml file, got %d", len(entries))
+	}
+	if !strings.HasSuffix(entries[0].Name(), ".eml") {
+		t.Errorf("file name = %q, want suffix .eml", entries[0].Name())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	// m.Header() はメッセージ毎にランダムな境界文字列やDateを生成するため、
+	// 再度呼び出した結果とのバイト完全一致は比較できない。代わりに書き出された
+	// 内容が期待するヘッダ/本文を含んでいることを確認する
+	content := string(data)
+	if !strings.Contains(content, "From: <sender@example.com>") {
+		t.Errorf("file content missing From header: %q", content)
+	}
+	if !strings.Contains(content, "Subject: hi") {
+		t.Errorf("file content missing Subject header: %q", content)
+	}
+}
+
+func TestFileMailerPingMissingDir(t *testing.T) {
+	f := &FileMailer{Dir: filepath.Join(t.TempDir(), "does-not-exist")}
+	if err := f.Ping(1000); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	l := &LogMailer{Writer: &buf}
+
+	if err := l.Ping(1000); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	m := &Mail{From: "sender@example.com", To: []string{"to@example.com"}, Subject: "hi", Body: "hello"}
+	if err := l.Send(m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	content := buf.String()
+	if !strings.Contains(content, "From: <sender@example.com>") {
+		t.Errorf("written content missing From header: %q", content)
+	}
+	if !strings.Contains(content, "Subject: hi") {
+		t.Errorf("written content missing Subject header: %q", content)
+	}
+}
+
+func TestLogMailerNilMail(t *testing.T) {
+	var buf bytes.Buffer
+	l := &LogMailer{Writer: &buf}
+	if err := l.Send(nil); err == nil {
+		t.Fatal("expected an error when sending a nil mail")
+	}
+}
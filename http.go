@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// mailgunEndpoint : Endpoint が未設定の場合に使用するデフォルトのAPIエンドポイント
+const mailgunEndpoint = "https://api.mailgun.net"
+
+// HTTPMailer : HTTP API 経由でメールを送信する構造体（Mailgunのメッセージ送信APIに準拠）
+// 送信元にポート25/587が塞がれている環境でも、mail.Mail をそのまま使って送信できる
+type HTTPMailer struct {
+	Endpoint      string       // APIのベースURL。空の場合は mailgunEndpoint を使用
+	Domain        string       // 送信ドメイン
+	PrivateAPIKey string       // private API キー（メール送信に使用）
+	PublicAPIKey  string       // public API キー（将来の検証用途のために保持）
+	Client        *http.Client // HTTPクライアント。nilの場合は http.DefaultClient を使用
+}
+
+// client : 送信に使用するHTTPクライアントを返却する
+func (h *HTTPMailer) client() *http.Client {
+	if h.Client != nil {
+		return h.Client
+	}
+	return http.DefaultClient
+}
+
+// endpoint : メッセージ送信APIのURLを組み立てる
+func (h *HTTPMailer) endpoint() string {
+	base := h.Endpoint
+	if base == "" {
+		base = mailgunEndpoint
+	}
+	return fmt.Sprintf("%s/v3/%s/messages", strings.TrimRight(base, "/"), h.Domain)
+}
+
+// Ping : APIサーバとの疎通確認
+func (h *HTTPMailer) Ping(timeout int) error {
+	var ch = make(chan error)
+	// リクエストを投げて疎通確認する
+	go func() {
+		req, err := http.NewRequest(http.MethodGet, h.endpoint(), nil)
+		if err != nil {
+			ch <- err
+			return
+		}
+		req.SetBasicAuth("api", h.PrivateAPIKey)
+
+		resp, err := h.client().Do(req)
+		if err != nil {
+			ch <- err
+			return
+		}
+		resp.Body.Close()
+		ch <- nil
+	}()
+	// 指定時間内に処理結果が得られない場合、エラーを返却する
+	go func() {
+		time.Sleep(time.Duration(timeout) * time.Millisecond)
+		ch <- fmt.Errorf("'%s' connection refused. timeout error", h.endpoint())
+	}()
+	return <-ch
+}
+
+// Send : メールをHTTP API経由で送信する
+func (h *HTTPMailer) Send(m *Mail) error {
+	if m == nil {
+		return fmt.Errorf("not mail object")
+	}
+	if m.From == "" {
+		return fmt.Errorf("`from` is nil")
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fields := map[string]string{
+		"from": m.From,
+	}
+	if len(m.To) > 0 {
+		fields["to"] = strings.Join(m.To, ",")
+	}
+	if len(m.Cc) > 0 {
+		fields["cc"] = strings.Join(m.Cc, ",")
+	}
+	if len(m.Bcc) > 0 {
+		fields["bcc"] = strings.Join(m.Bcc, ",")
+	}
+	if m.Subject != "" {
+		fields["subject"] = m.Subject
+	}
+
+	// TextBody/HTMLBody が設定されていればそちらを優先し、無ければ従来のBody/Formatを使う
+	switch {
+	case m.TextBody != "" || m.HTMLBody != "":
+		if m.TextBody != "" {
+			fields["text"] = m.TextBody
+		}
+		if m.HTMLBody != "" {
+			fields["html"] = m.HTMLBody
+		}
+	case m.Format == "html":
+		fields["html"] = m.Body
+	default:
+		fields["text"] = m.Body
+	}
+
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+
+	// 添付ファイルを multipart/form-data のファイルパートとして追加する
+	for _, a := range m.attachFiles() {
+		part, err := w.CreateFormFile("attachment", a.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(a.data); err != nil {
+			return err
+		}
+	}
+
+	// インライン埋め込み(CID)ファイルを "inline" フィールドとして追加する
+	// Content-ID を明示することで、HTML本文の <img src="cid:..."> と対応付ける
+	for _, e := range m.embeds {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="inline"; filename="%s"`, e.filename))
+		header.Set("Content-Type", e.contentType)
+		header.Set("Content-ID", fmt.Sprintf("<%s>", e.cid))
+
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(e.data); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.endpoint(), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("api", h.PrivateAPIKey)
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("mailgun api error. status = %d, body = %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
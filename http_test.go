@@ -0,0 +1,168 @@
+package mail
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPMailerEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		domain   string
+		want     string
+	}{
+		{"default endpoint", "", "example.com", "https://api.mailgun.net/v3/example.com/messages"},
+		{"custom endpoint without trailing slash", "https://api.eu.mailgun.net", "example.com", "https://api.eu.mailgun.net/v3/example.com/messages"},
+		{"custom endpoint with trailing slash", "https://api.eu.mailgun.net/", "example.com", "https://api.eu.mailgun.net/v3/example.com/messages"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HTTPMailer{Endpoint: tt.endpoint, Domain: tt.domain}
+			if got := h.endpoint(); got != tt.want {
+				t.Errorf("endpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPMailerPing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	h := &HTTPMailer{Endpoint: ts.URL, Domain: "example.com", PrivateAPIKey: "key-test"}
+	if err := h.Ping(1000); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+func TestHTTPMailerSend(t *testing.T) {
+	var (
+		gotPath         string
+		gotUser, gotKey string
+		gotOK           bool
+		gotForm         map[string][]string
+		gotAttachments  []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, gotKey, gotOK = r.BasicAuth()
+
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		gotForm = map[string][]string(r.MultipartForm.Value)
+		for _, fh := range r.MultipartForm.File["attachment"] {
+			gotAttachments = append(gotAttachments, fh.Filename)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	h := &HTTPMailer{Endpoint: ts.URL, Domain: "example.com", PrivateAPIKey: "key-test"}
+
+	m := &Mail{
+		From:    "sender@example.com",
+		To:      []string{"to@example.com"},
+		Cc:      []string{"cc@example.com"},
+		Bcc:     []string{"bcc@example.com"},
+		Subject: "hello",
+		Body:    "plain body",
+	}
+	m.AttachData([]byte("file contents"), "note.txt")
+
+	if err := h.Send(m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if gotPath != "/v3/example.com/messages" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if !gotOK || gotUser != "api" || gotKey != "key-test" {
+		t.Errorf("basic auth = (%q, %q, ok=%v), want (api, key-test, true)", gotUser, gotKey, gotOK)
+	}
+
+	want := map[string]string{
+		"from":    "sender@example.com",
+		"to":      "to@example.com",
+		"cc":      "cc@example.com",
+		"bcc":     "bcc@example.com",
+		"subject": "hello",
+		"text":    "plain body",
+	}
+	for key, wantValue := range want {
+		values, ok := gotForm[key]
+		if !ok || len(values) == 0 {
+			t.Errorf("form field %q missing", key)
+			continue
+		}
+		if values[0] != wantValue {
+			t.Errorf("form field %q = %q, want %q", key, values[0], wantValue)
+		}
+	}
+	if _, ok := gotForm["html"]; ok {
+		t.Errorf("unexpected html field for a plain-text mail")
+	}
+
+	if len(gotAttachments) != 1 || gotAttachments[0] != "note.txt" {
+		t.Errorf("attachments = %v, want [note.txt]", gotAttachments)
+	}
+}
+
+func TestHTTPMailerSendBothBodies(t *testing.T) {
+	var gotForm map[string][]string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		gotForm = map[string][]string(r.MultipartForm.Value)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	h := &HTTPMailer{Endpoint: ts.URL, Domain: "example.com"}
+	m := &Mail{
+		From:     "sender@example.com",
+		To:       []string{"to@example.com"},
+		TextBody: "plain alt",
+		HTMLBody: "<p>html alt</p>",
+	}
+
+	if err := h.Send(m); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := gotForm["text"][0]; got != "plain alt" {
+		t.Errorf("text field = %q, want %q", got, "plain alt")
+	}
+	if got := gotForm["html"][0]; got != "<p>html alt</p>" {
+		t.Errorf("html field = %q, want %q", got, "<p>html alt</p>")
+	}
+}
+
+func TestHTTPMailerSendErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"bad request"}`))
+	}))
+	defer ts.Close()
+
+	h := &HTTPMailer{Endpoint: ts.URL, Domain: "example.com"}
+	m := &Mail{From: "sender@example.com", To: []string{"to@example.com"}, Body: "x"}
+
+	err := h.Send(m)
+	if err == nil {
+		t.Fatal("expected an error for a non-2xx response")
+	}
+	if !strings.Contains(err.Error(), "400") {
+		t.Errorf("error = %v, want it to mention the status code", err)
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"mime/multipart"
+	"net/http"
 	"net/smtp"
 	"net/textproto"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -18,8 +21,14 @@ import (
 var random = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 const (
-	// PlainAuth 認証を用いる
+	// PlainAuth : PLAIN認証を用いる
 	PlainAuth = "plain"
+	// CRAMMD5Auth : CRAM-MD5認証を用いる
+	CRAMMD5Auth = "cram-md5"
+	// LoginAuth : LOGIN認証を用いる（サーバから Username:/Password: の順でプロンプトされる方式）
+	LoginAuth = "login"
+	// NoAuth : 認証を行わない
+	NoAuth = "none"
 )
 
 // SMTP : メールサーバとの接続を管理する構造体
@@ -29,16 +38,74 @@ type SMTP struct {
 	Username string // SMTPサーバのユーザID
 	Password string // SMTPサーバのパスワード
 	StartTLS bool   // StartTLS を許可
+	SSL      bool   // 暗黙的TLS（ポート465相当）で接続する。StartTLSとは排他
 	Insecure bool   // 自己署名証明書を認める
-	Auth     string // 認証機構。現状 plain のみ
+	Auth     string // 認証機構。plain/cram-md5/login/none
+}
+
+// loginAuth : LOGIN認証を行う smtp.Auth の実装
+type loginAuth struct {
+	username string
+	password string
+}
+
+// Start : LOGIN認証の開始
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+// Next : サーバからの Username:/Password: プロンプトに応答する
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unknown login auth prompt: %s", fromServer)
+	}
+}
+
+// auth : Auth の設定値に応じた smtp.Auth を生成する
+func (s *SMTP) auth() smtp.Auth {
+	switch s.Auth {
+	case CRAMMD5Auth:
+		return smtp.CRAMMD5Auth(s.Username, s.Password)
+	case LoginAuth:
+		return &loginAuth{username: s.Username, password: s.Password}
+	default:
+		return smtp.PlainAuth("", s.Username, s.Password, s.Address)
+	}
+}
+
+// dial : SMTPサーバへ接続する。SSLが有効な場合は、ハンドシェイク前に暗黙的TLSで接続する
+func (s *SMTP) dial() (*smtp.Client, error) {
+	hostname := fmt.Sprintf("%s:%d", s.Address, s.Port)
+	if s.SSL {
+		conn, err := tls.Dial("tcp", hostname, &tls.Config{
+			InsecureSkipVerify: s.Insecure,
+			ServerName:         s.Address,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, s.Address)
+	}
+	return smtp.Dial(hostname)
 }
 
 // Ping : メールサーバとの疎通確認
 func (s *SMTP) Ping(timeout int) error {
 	var ch = make(chan error)
-	// Dial を用いて疎通確認する
+	// dial を用いて疎通確認する（SSLが有効な場合も正しく暗黙的TLSで接続する）
 	go func() {
-		_, err := smtp.Dial(fmt.Sprintf("%s:%d", s.Address, s.Port))
+		client, err := s.dial()
+		if err == nil {
+			client.Close()
+		}
 		ch <- err
 	}()
 	// 指定時間内に処理結果が得られない場合、エラーを返却する
@@ -56,7 +123,7 @@ func (s *SMTP) Validate(timeout int) error {
 		return err
 	}
 	// 認証が有効の状態の場合、ユーザ名とパスワードは設定されているか確認
-	if s.Auth == PlainAuth {
+	if s.Auth != NoAuth {
 		if s.Username == "" || s.Password == "" {
 			return fmt.Errorf("user or password is not setting")
 		}
@@ -64,32 +131,31 @@ func (s *SMTP) Validate(timeout int) error {
 	return nil
 }
 
-// TLS認証のメールを送信
+// SSL/StartTLSでの接続を確立してメールを送信する（認証を行わない場合も含む）
 func (s *SMTP) sendTLSSubmission(m *Mail) error {
 	// SMTPサーバに接続開始
-	client, err := smtp.Dial(fmt.Sprintf("%s:%d", s.Address, s.Port))
+	client, err := s.dial()
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
-	// StartTLSを使用する
-	if s.StartTLS {
+	// StartTLSを使用する（SSLで既に暗号化されている場合は行わない）
+	if s.StartTLS && !s.SSL {
 		client.StartTLS(&tls.Config{
 			InsecureSkipVerify: s.Insecure,
 			ServerName:         s.Address,
 		})
 	}
 
-	// 認証に必要な情報が揃っているかチェック
-	if s.Username == "" || s.Password == "" {
-		return fmt.Errorf("user or password is nil")
-	}
-
-	// 認証
-	auth := smtp.PlainAuth("", s.Username, s.Password, s.Address)
-	if err := client.Auth(auth); err != nil {
-		return err
+	// 認証を必要とする場合のみ、認証に必要な情報が揃っているかチェックして認証する
+	if s.Auth != NoAuth {
+		if s.Username == "" || s.Password == "" {
+			return fmt.Errorf("user or password is nil")
+		}
+		if err := client.Auth(s.auth()); err != nil {
+			return err
+		}
 	}
 
 	// 送信情報、送信元情報をRcptへ追加する
@@ -140,7 +206,7 @@ func (s *SMTP) sendSubmission(m *Mail) error {
 	}
 
 	// 認証
-	auth := smtp.PlainAuth("", s.Username, s.Password, s.Address)
+	auth := s.auth()
 
 	// メール送信情報を取得
 	header, err := m.Header()
@@ -164,7 +230,7 @@ func (s *SMTP) sendSubmission(m *Mail) error {
 // SMTPメール送信を行う関数
 func (s *SMTP) sendSMTP(m *Mail) error {
 	// SMTPサーバに接続開始
-	client, err := smtp.Dial(fmt.Sprintf("%s:%d", s.Address, s.Port))
+	client, err := s.dial()
 	if err != nil {
 		return fmt.Errorf("dial error = [%s:%d]. error = %s", s.Address, s.Port, err)
 	}
@@ -216,29 +282,100 @@ func (s *SMTP) Send(m *Mail) error {
 	if m == nil {
 		return fmt.Errorf("not mail object")
 	}
+	// SSL/StartTLSが指定されている場合は、認証の有無によらず手動ダイヤルでネゴシエーションする
+	if s.SSL || s.StartTLS {
+		return s.sendTLSSubmission(m)
+	}
 	// 認証を必要としない場合、25ポートのメールとして送信
-	if s.Auth == PlainAuth {
+	if s.Auth == NoAuth {
 		return s.sendSMTP(m)
 	}
-	// 認証を必要する場合でかつ、TLS認証の場合
-	if s.StartTLS {
-		return s.sendTLSSubmission(m)
-	}
-	// TLS認証ではない、認証メールの場合
+	// SSL/StartTLSではない、認証メールの場合
 	return s.sendSubmission(m)
 }
 
 // Mail 送信情報を管理する構造体
 type Mail struct {
-	Subject string   // 件名
-	From    string   // 送信元
-	To      []string // 宛先
-	Cc      []string // Cc
-	Bcc     []string // Bcc
-	ReplyTo string   // 返信元アドレス
-	Body    string   // 本文
-	Format  string   // text or html
-	attach  string   // 添付ファイル
+	Subject  string      // 件名
+	From     string      // 送信元
+	To       []string    // 宛先
+	Cc       []string    // Cc
+	Bcc      []string    // Bcc
+	ReplyTo  string      // 返信元アドレス
+	Body     string      // 本文（Format と組み合わせて使用。TextBody/HTMLBody との互換のため残置）
+	Format   string      // text or html
+	TextBody string      // プレーンテキスト本文
+	HTMLBody string      // HTML本文。TextBodyと両方設定するとmultipart/alternativeで送信する
+	attach   string      // 添付ファイル
+	embeds   []embedPart // インライン埋め込み(CID)ファイル
+}
+
+// embedPart : インライン埋め込み（CID参照）用パート1件分の情報
+type embedPart struct {
+	filename    string
+	cid         string
+	contentType string
+	data        []byte
+}
+
+// Recipient : 表示名とメールアドレスの組
+type Recipient struct {
+	Name    string // 表示名（任意）
+	Address string // メールアドレス
+}
+
+// String : ヘッダへ出力する "Name <addr@host>" 形式の文字列を返す
+func (r Recipient) String() string {
+	if r.Name == "" {
+		return fmt.Sprintf("<%s>", r.Address)
+	}
+	return fmt.Sprintf("%s <%s>", formatDisplayName(r.Name), r.Address)
+}
+
+// rfc5322Specials : quoted-string化せずにヘッダへ出すと区切り文字と誤認される文字
+const rfc5322Specials = `()<>[]:;@\,."`
+
+// formatDisplayName : 表示名をヘッダへ出力できる形式に整形する
+// ASCII範囲外を含む場合はRFC 2047でエンコードする（エンコード後のトークンにカンマ等は現れないため引用は不要）。
+// それ以外でカンマ等の特殊文字を含む場合は quoted-string として "..." で囲み、内部の " と \ をエスケープする
+func formatDisplayName(name string) string {
+	if needsEncoding(name) {
+		return encodeWord(name)
+	}
+	if strings.ContainsAny(name, rfc5322Specials) {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name)
+		return `"` + escaped + `"`
+	}
+	return name
+}
+
+// recipientPattern : "Name <addr@host>" 形式を解析する正規表現
+var recipientPattern = regexp.MustCompile(`^\s*(.*?)\s*<([^<>]+)>\s*$`)
+
+// parseRecipient : "Name <addr@host>" 形式、または "addr@host" 単体の文字列を Recipient へ変換する
+func parseRecipient(raw string) Recipient {
+	if m := recipientPattern.FindStringSubmatch(raw); m != nil {
+		return Recipient{Name: unquoteDisplayName(m[1]), Address: m[2]}
+	}
+	return Recipient{Address: strings.TrimSpace(raw)}
+}
+
+// unquoteDisplayName : quoted-string形式（"..."）の表示名をエスケープ解除して元の文字列に戻す
+func unquoteDisplayName(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		inner := name[1 : len(name)-1]
+		return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(inner)
+	}
+	return name
+}
+
+// joinRecipients : 宛先一覧をヘッダ用の1行（カンマ区切り）に変換する
+func joinRecipients(raw []string) string {
+	parts := make([]string, len(raw))
+	for i, v := range raw {
+		parts[i] = parseRecipient(v).String()
+	}
+	return strings.Join(parts, ",")
 }
 
 // boundary : バウンダリ生成関数
@@ -254,6 +391,18 @@ func (m *Mail) boundary() string {
 	return string(buf)
 }
 
+// messageID : Message-Id ヘッダの値を生成する（boundary と同じ乱数ソースを使用）
+func (m *Mail) messageID() string {
+	domain := parseRecipient(m.From).Address
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	if domain == "" {
+		domain = "localhost"
+	}
+	return fmt.Sprintf("<%s@%s>", m.boundary(), domain)
+}
+
 // Content : フォーマット文字列からContentを取得する
 func (m *Mail) Content() string {
 	if m.Format == "html" {
@@ -262,46 +411,77 @@ func (m *Mail) Content() string {
 	return "text/plain"
 }
 
-// subjectEncode : 件名のエンコードを実施
+// subjectEncode : 件名のエンコードを実施（RFC 2047）
 func (m *Mail) subjectEncode() string {
+	if !needsEncoding(m.Subject) {
+		return fmt.Sprintf("Subject: %s\r\n", m.Subject)
+	}
+
 	var buffer bytes.Buffer
 	buffer.WriteString("Subject:")
 
-	for _, line := range m.splitUTF8(13) {
-		buffer.WriteString(" =?utf-8?B?")
-		buffer.WriteString(base64.StdEncoding.EncodeToString([]byte(line)))
-		buffer.WriteString("?=\r\n")
+	for _, token := range encodeWords(m.Subject) {
+		buffer.WriteString(" ")
+		buffer.WriteString(token)
+		buffer.WriteString("\r\n")
 	}
 
 	return buffer.String()
 }
 
-// splitUTF8 : UTF8区切り
-func (m *Mail) splitUTF8(length int) []string {
-	var buffer bytes.Buffer
-	var result []string
-
-	for k, c := range strings.Split(m.Subject, "") {
-		buffer.WriteString(c)
-		if k%length == length-1 {
-			result = append(result, buffer.String())
-			buffer.Reset()
+// needsEncoding : ASCII範囲外の文字を含み、RFC 2047 エンコードが必要かどうかを判定する
+func needsEncoding(s string) bool {
+	for _, r := range s {
+		if r > 127 {
+			return true
 		}
 	}
+	return false
+}
+
+// encodeWords : 文字列を "=?utf-8?B?...?=" 形式のエンコードワード列に分割する
+// 各ワードはBase64展開後も75オクテット以内に収まるよう、ルーン単位で詰め込む
+func encodeWords(s string) []string {
+	const prefix = "=?utf-8?B?"
+	const suffix = "?="
+	const limit = 75
+
+	fits := func(runes []rune) bool {
+		return len(prefix)+base64.StdEncoding.EncodedLen(len(string(runes)))+len(suffix) <= limit
+	}
+
+	var tokens []string
+	var current []rune
 
-	if buffer.Len() > 0 {
-		result = append(result, buffer.String())
+	for _, r := range s {
+		candidate := append(append([]rune{}, current...), r)
+		if !fits(candidate) && len(current) > 0 {
+			tokens = append(tokens, prefix+base64.StdEncoding.EncodeToString([]byte(string(current)))+suffix)
+			current = []rune{r}
+			continue
+		}
+		current = candidate
+	}
+	if len(current) > 0 {
+		tokens = append(tokens, prefix+base64.StdEncoding.EncodeToString([]byte(string(current)))+suffix)
 	}
 
-	return result
+	return tokens
+}
+
+// encodeWord : 表示名などの1トークンをRFC 2047でエンコードする。ASCIIのみの場合はそのまま返す
+func encodeWord(s string) string {
+	if !needsEncoding(s) {
+		return s
+	}
+	return strings.Join(encodeWords(s), "\r\n ")
 }
 
-// bodyEncode : 本文をBase64へエンコード
-func (m *Mail) bodyEncode() string {
+// encodeBase64 : バイト列をBase64へエンコードする
+func encodeBase64(data []byte) string {
 	var result bytes.Buffer
 
-	buf := bytes.NewBufferString(m.Body).Bytes()
-	msg := base64.StdEncoding.EncodeToString(buf)
+	msg := base64.StdEncoding.EncodeToString(data)
 	// Base64文字列の76文字目に \r\n を付与する
 	for k, c := range strings.Split(msg, "") {
 		result.WriteString(c)
@@ -313,6 +493,69 @@ func (m *Mail) bodyEncode() string {
 	return result.String()
 }
 
+// singlePart : TextBody/HTMLBodyが片方のみ指定された場合、または従来のBody/Formatを使う場合の本文を解決する
+func (m *Mail) singlePart() (string, string) {
+	switch {
+	case m.TextBody != "" && m.HTMLBody == "":
+		return "text/plain", m.TextBody
+	case m.HTMLBody != "" && m.TextBody == "":
+		return "text/html", m.HTMLBody
+	default:
+		return m.Content(), m.Body
+	}
+}
+
+// bodyPart : 本文パートを組み立てる。TextBody/HTMLBody が両方設定されている場合は
+// multipart/alternative としてプレーンテキストとHTMLの両方を含める
+func (m *Mail) bodyPart() string {
+	if m.TextBody != "" && m.HTMLBody != "" {
+		alt := `Content-Type: multipart/alternative; boundary={{A}}
+
+--{{A}}
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+%s
+--{{A}}
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: base64
+
+%s
+--{{A}}--`
+		part := fmt.Sprintf(alt, encodeBase64([]byte(m.TextBody)), encodeBase64([]byte(m.HTMLBody)))
+		return strings.Replace(part, "{{A}}", m.boundary(), -1)
+	}
+
+	contentType, body := m.singlePart()
+	return fmt.Sprintf(`Content-Type: %s; charset=utf-8
+Content-Transfer-Encoding: base64
+
+%s`, contentType, encodeBase64([]byte(body)))
+}
+
+// relatedPart : 本文とインライン埋め込み(CID)ファイルをまとめた multipart/related パートを組み立てる
+// 埋め込みファイルが無い場合は bodyPart() の結果をそのまま返す
+func (m *Mail) relatedPart() string {
+	if len(m.embeds) == 0 {
+		return m.bodyPart()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(m.bodyPart())
+	for _, e := range m.embeds {
+		buf.WriteString("\r\n--{{R}}\r\n")
+		buf.WriteString(fmt.Sprintf(`Content-Type: %s; name="%s"
+Content-Transfer-Encoding: base64
+Content-Disposition: inline; filename="%s"
+Content-ID: <%s>
+
+%s`, e.contentType, e.filename, e.filename, e.cid, encodeBase64(e.data)))
+	}
+
+	related := "Content-Type: multipart/related; boundary={{R}}\r\n\r\n--{{R}}\r\n" + buf.String() + "\r\n--{{R}}--"
+	return strings.Replace(related, "{{R}}", m.boundary(), -1)
+}
+
 // Header : メールヘッダを作成する
 func (m *Mail) Header() (string, error) {
 	var header string
@@ -321,26 +564,30 @@ func (m *Mail) Header() (string, error) {
 	if m.From == "" {
 		return "", fmt.Errorf("`from` is nil")
 	}
-	header = fmt.Sprintf("From: <%s>\r\n", m.From)
+	header = fmt.Sprintf("From: %s\r\n", parseRecipient(m.From).String())
 
 	// 返信元アドレスをチェック
 	replyto := m.ReplyTo
 	if replyto == "" {
 		replyto = m.From
 	}
-	header += fmt.Sprintf("Reply-To: %s\r\n", replyto)
+	header += fmt.Sprintf("Reply-To: %s\r\n", parseRecipient(replyto).String())
 
 	// 宛先/Cc/Bcc をヘッダへ追加する
 	if len(m.To) > 0 {
-		header += "To: " + strings.Join(m.To, ",") + "\r\n"
+		header += "To: " + joinRecipients(m.To) + "\r\n"
 	}
 	if len(m.Cc) > 0 {
-		header += "Cc: " + strings.Join(m.Cc, ",") + "\r\n"
+		header += "Cc: " + joinRecipients(m.Cc) + "\r\n"
 	}
 	if len(m.Bcc) > 0 {
-		header += "Bcc: " + strings.Join(m.Bcc, ",") + "\r\n"
+		header += "Bcc: " + joinRecipients(m.Bcc) + "\r\n"
 	}
 
+	// Message-Id/Date をヘッダへ追加する（無いとスパム判定されるMTAが多いため）
+	header += fmt.Sprintf("Message-Id: %s\r\n", m.messageID())
+	header += fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+
 	// 件名をヘッダへ追加
 	if m.Subject == "" {
 		m.Subject = "Subject: \r\n"
@@ -354,22 +601,14 @@ func (m *Mail) Header() (string, error) {
 		attach := `MIME-Version: 1.0
 Content-Type: multipart/mixed; boundary={{B}}
 --{{B}}
-Content-Type: %s; charset=utf-8
-Content-Transfer-Encoding: base64
-
-%s
+` + m.relatedPart() + `
 --{{B}}`
-		header += fmt.Sprintf(attach, m.Content(), m.bodyEncode())
+		header += attach
 		header += m.attach + "--"
 		header = strings.Replace(header, "{{B}}", m.boundary(), -1)
 	} else {
 		// (添付ファイル無しの場合)
-		header += `MIME-Version: 1.0
-Content-Type: %s; charset=utf-8
-Content-Transfer-Encoding: base64
-
-` + m.bodyEncode()
-		header = fmt.Sprintf(header, m.Content())
+		header += "MIME-Version: 1.0\r\n" + m.relatedPart()
 	}
 
 	return header, nil
@@ -411,3 +650,66 @@ Content-Disposition: attachment; filename="%s"
 	attach = fmt.Sprintf(attach, filename, filename, encoded)
 	m.attach += attach
 }
+
+// EmbedFile : サーバ内にあるファイルをインライン画像(CID参照)として埋め込む
+func (m *Mail) EmbedFile(path, cid string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m.EmbedData(data, filepath.Base(path), cid)
+	return nil
+}
+
+// EmbedForm : ブラウザ等のフォームからアップロードされたファイルをインライン画像(CID参照)として埋め込む
+func (m *Mail) EmbedForm(file multipart.File, filename, cid string) error {
+	if file == nil {
+		return fmt.Errorf("embed file is nil")
+	}
+
+	var data bytes.Buffer
+	io.Copy(&data, file)
+
+	m.EmbedData(data.Bytes(), filename, cid)
+	return nil
+}
+
+// EmbedData : インライン画像(CID参照)を付与する関数
+// HTML本文から <img src="cid:{{cid}}"> の形式で参照できる
+func (m *Mail) EmbedData(data []byte, filename, cid string) {
+	m.embeds = append(m.embeds, embedPart{
+		filename:    filename,
+		cid:         cid,
+		contentType: http.DetectContentType(data),
+		data:        data,
+	})
+}
+
+// attachFile : m.attach 復元時に使用する、添付ファイル1件分のファイル名とデータ
+type attachFile struct {
+	filename string
+	data     []byte
+}
+
+// attachFilesPattern : m.attach のテンプレートから添付ファイル部分を抜き出す正規表現
+var attachFilesPattern = regexp.MustCompile(`filename="([^"]+)"\r?\n\r?\n([\s\S]*?)\r?\n--\{\{B\}\}`)
+
+// attachFiles : 組み立て済みの m.attach からファイル名と添付データを復元する
+// （HTTP API 経由の送信など、MIMEテキストではなくファイル単位のデータが必要な場合に使用）
+func (m *Mail) attachFiles() []attachFile {
+	var result []attachFile
+	if m.attach == "" {
+		return result
+	}
+
+	for _, match := range attachFilesPattern.FindAllStringSubmatch(m.attach, -1) {
+		encoded := strings.NewReplacer("\r", "", "\n", "").Replace(match[2])
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		result = append(result, attachFile{filename: match[1], data: data})
+	}
+
+	return result
+}
@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// decodeBodyPart : "Content-Type: ...\n\n<base64>" 形式のパート文字列から
+// Content-Typeヘッダとデコード済み本文を取り出す
+func decodeBodyPart(t *testing.T, part string) (contentType, body string) {
+	t.Helper()
+
+	segs := strings.SplitN(part, "\n\n", 2)
+	if len(segs) != 2 {
+		t.Fatalf("malformed part, no header/body separator: %q", part)
+	}
+	header, encoded := segs[0], segs[1]
+
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, "Content-Type:") {
+			contentType = strings.TrimSpace(strings.TrimPrefix(line, "Content-Type:"))
+		}
+	}
+
+	cleaned := strings.NewReplacer("\r", "", "\n", "").Replace(encoded)
+	raw, err := base64.StdEncoding.DecodeString(cleaned)
+	if err != nil {
+		t.Fatalf("invalid base64 body: %v", err)
+	}
+	return contentType, string(raw)
+}
+
+func TestSinglePart(t *testing.T) {
+	tests := []struct {
+		name     string
+		mail     *Mail
+		wantCT   string
+		wantBody string
+	}{
+		{
+			name:     "legacy Body/Format text",
+			mail:     &Mail{Body: "legacy plain", Format: "text"},
+			wantCT:   "text/plain",
+			wantBody: "legacy plain",
+		},
+		{
+			name:     "legacy Body/Format html",
+			mail:     &Mail{Body: "<p>legacy html</p>", Format: "html"},
+			wantCT:   "text/html",
+			wantBody: "<p>legacy html</p>",
+		},
+		{
+			name:     "TextBody only",
+			mail:     &Mail{TextBody: "only text"},
+			wantCT:   "text/plain",
+			wantBody: "only text",
+		},
+		{
+			name:     "HTMLBody only",
+			mail:     &Mail{HTMLBody: "<p>only html</p>"},
+			wantCT:   "text/html",
+			wantBody: "<p>only html</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part := tt.mail.bodyPart()
+			ct, body := decodeBodyPart(t, part)
+			if !strings.HasPrefix(ct, tt.wantCT) {
+				t.Errorf("content-type = %q, want prefix %q", ct, tt.wantCT)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBodyPartAlternative(t *testing.T) {
+	m := &Mail{TextBody: "plain text", HTMLBody: "<p>html text</p>"}
+	part := m.bodyPart()
+
+	const prefix = "Content-Type: multipart/alternative; boundary="
+	if !strings.HasPrefix(part, prefix) {
+		t.Fatalf("expected multipart/alternative, got: %q", part)
+	}
+	boundary := strings.TrimPrefix(strings.SplitN(part, "\n", 2)[0], prefix)
+
+	segments := strings.Split(part, "--"+boundary)
+	if len(segments) != 4 {
+		t.Fatalf("expected header + 2 parts + closing segment, got %d segments: %q", len(segments), part)
+	}
+
+	plainCT, plainBody := decodeBodyPart(t, strings.TrimPrefix(segments[1], "\n"))
+	if !strings.HasPrefix(plainCT, "text/plain") {
+		t.Errorf("first part content-type = %q", plainCT)
+	}
+	if plainBody != "plain text" {
+		t.Errorf("first part body = %q", plainBody)
+	}
+
+	htmlCT, htmlBody := decodeBodyPart(t, strings.TrimPrefix(segments[2], "\n"))
+	if !strings.HasPrefix(htmlCT, "text/html") {
+		t.Errorf("second part content-type = %q", htmlCT)
+	}
+	if htmlBody != "<p>html text</p>" {
+		t.Errorf("second part body = %q", htmlBody)
+	}
+
+	if segments[3] != "--" {
+		t.Errorf("expected alternative part to close with '--', got %q", segments[3])
+	}
+}
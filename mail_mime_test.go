@@ -0,0 +1,161 @@
+package mail
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// topLevelBoundary : Header() が返す生テキストから、トップレベルのmultipart境界文字列を取り出す
+// (この階層はメール自体のヘッダであり multipart.Part として読めないため、正規表現で抜き出す)
+func topLevelBoundary(t *testing.T, header, mimeType string) string {
+	t.Helper()
+	re := regexp.MustCompile(`Content-Type: ` + regexp.QuoteMeta(mimeType) + `; boundary=(\S+)`)
+	match := re.FindStringSubmatch(header)
+	if match == nil {
+		t.Fatalf("no %s boundary found in header: %q", mimeType, header)
+	}
+	return match[1]
+}
+
+// multipartBodyReader : boundary の最初の出現位置から後ろを multipart.Reader に渡せるようにする
+func multipartBodyReader(header, boundary string) *multipart.Reader {
+	idx := strings.Index(header, "--"+boundary)
+	return multipart.NewReader(strings.NewReader(header[idx:]), boundary)
+}
+
+// readPartBody : パート本文をデコードせずにそのまま読み出す（base64のままの文字列を返す）
+func readPartBody(t *testing.T, part *multipart.Part) string {
+	t.Helper()
+	raw, err := ioutil.ReadAll(part)
+	if err != nil {
+		t.Fatalf("read part: %v", err)
+	}
+	return string(raw)
+}
+
+// TestRelatedPartMIMENesting は、添付・インライン埋め込み・テキスト/HTML両方を
+// 持つメールの Header() 出力が
+//
+//	multipart/mixed -> multipart/related -> [multipart/alternative -> [text/plain, text/html], 埋め込み画像] + 添付ファイル
+//
+// という階層として正しく組み立てられ、実際に mime/multipart.Reader で読めることを確認する
+func TestRelatedPartMIMENesting(t *testing.T) {
+	m := &Mail{
+		From:     "sender@example.com",
+		To:       []string{"to@example.com"},
+		Subject:  "hi",
+		TextBody: "plain body",
+		HTMLBody: `<p>html body with <img src="cid:logo"></p>`,
+	}
+	m.EmbedData([]byte("\x89PNG\r\n\x1a\n"), "logo.png", "logo")
+	m.AttachData([]byte("attachment contents"), "note.txt")
+
+	header, err := m.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+
+	mixedBoundary := topLevelBoundary(t, header, "multipart/mixed")
+	mixedReader := multipartBodyReader(header, mixedBoundary)
+
+	// --- multipart/mixed の1つ目: multipart/related ---
+	relatedPart, err := mixedReader.NextPart()
+	if err != nil {
+		t.Fatalf("mixed: related part: %v", err)
+	}
+	relatedCT := relatedPart.Header.Get("Content-Type")
+	if !strings.HasPrefix(relatedCT, "multipart/related") {
+		t.Fatalf("expected multipart/related, got %q", relatedCT)
+	}
+	_, relatedParams, err := mime.ParseMediaType(relatedCT)
+	if err != nil {
+		t.Fatalf("parse related content-type: %v", err)
+	}
+	relatedReader := multipart.NewReader(relatedPart, relatedParams["boundary"])
+
+	// --- multipart/related の1つ目: multipart/alternative ---
+	altPart, err := relatedReader.NextPart()
+	if err != nil {
+		t.Fatalf("related: alternative part: %v", err)
+	}
+	altCT := altPart.Header.Get("Content-Type")
+	if !strings.HasPrefix(altCT, "multipart/alternative") {
+		t.Fatalf("expected multipart/alternative, got %q", altCT)
+	}
+	_, altParams, err := mime.ParseMediaType(altCT)
+	if err != nil {
+		t.Fatalf("parse alternative content-type: %v", err)
+	}
+	altReader := multipart.NewReader(altPart, altParams["boundary"])
+
+	plainPart, err := altReader.NextPart()
+	if err != nil {
+		t.Fatalf("alternative: plain part: %v", err)
+	}
+	if ct := plainPart.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("plain part content-type = %q", ct)
+	}
+	if body := readPartBody(t, plainPart); strings.TrimSpace(body) != "cGxhaW4gYm9keQ==" {
+		t.Errorf("plain part base64 body = %q, want base64 of %q", body, "plain body")
+	}
+
+	htmlPart, err := altReader.NextPart()
+	if err != nil {
+		t.Fatalf("alternative: html part: %v", err)
+	}
+	if ct := htmlPart.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("html part content-type = %q", ct)
+	}
+
+	if _, err := altReader.NextPart(); err != io.EOF {
+		t.Errorf("expected multipart/alternative to contain exactly 2 parts")
+	}
+
+	// --- multipart/related の2つ目: インライン埋め込み画像 ---
+	embedPart, err := relatedReader.NextPart()
+	if err != nil {
+		t.Fatalf("related: embed part: %v", err)
+	}
+	if cid := embedPart.Header.Get("Content-ID"); cid != "<logo>" {
+		t.Errorf("embed Content-ID = %q, want <logo>", cid)
+	}
+	if ct := embedPart.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/png") {
+		t.Errorf("embed Content-Type = %q, want prefix image/png", ct)
+	}
+	if disp := embedPart.Header.Get("Content-Disposition"); !strings.Contains(disp, "inline") || !strings.Contains(disp, `filename="logo.png"`) {
+		t.Errorf("embed Content-Disposition = %q", disp)
+	}
+
+	if _, err := relatedReader.NextPart(); err != io.EOF {
+		t.Errorf("expected multipart/related to contain exactly 2 parts (alternative + 1 embed)")
+	}
+
+	// --- multipart/mixed の2つ目: 添付ファイル ---
+	attachPart, err := mixedReader.NextPart()
+	if err != nil {
+		t.Fatalf("mixed: attachment part: %v", err)
+	}
+	if disp := attachPart.Header.Get("Content-Disposition"); !strings.Contains(disp, `filename="note.txt"`) {
+		t.Errorf("attachment Content-Disposition = %q", disp)
+	}
+
+	if _, err := mixedReader.NextPart(); err != io.EOF {
+		t.Errorf("expected multipart/mixed to contain exactly 2 parts (related + 1 attachment)")
+	}
+}
+
+// TestRelatedPartWithoutEmbeds は埋め込み画像が無い場合、multipart/related を
+// 挟まずに multipart/alternative がそのまま本文パートになることを確認する
+func TestRelatedPartWithoutEmbeds(t *testing.T) {
+	m := &Mail{TextBody: "plain only", HTMLBody: "<p>html only</p>"}
+
+	part := m.relatedPart()
+	if !strings.HasPrefix(part, "Content-Type: multipart/alternative; boundary=") {
+		t.Fatalf("expected relatedPart() to pass through to bodyPart() when there are no embeds, got: %q", part)
+	}
+}
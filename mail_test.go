@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncodeWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"ascii", "hello world"},
+		{"japanese", "こんにちは世界、テストメールです"},
+		{"emoji", strings.Repeat("😀", 10)},
+		{"mixed", "Hello, こんにちは！ Mixed テキスト"},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := encodeWords(tt.input)
+
+			var decoded strings.Builder
+			for _, token := range tokens {
+				if len(token) > 75 {
+					t.Errorf("token exceeds 75 octets (%d): %q", len(token), token)
+				}
+				if !strings.HasPrefix(token, "=?utf-8?B?") || !strings.HasSuffix(token, "?=") {
+					t.Fatalf("malformed encoded word: %q", token)
+				}
+				b64 := strings.TrimSuffix(strings.TrimPrefix(token, "=?utf-8?B?"), "?=")
+				raw, err := base64.StdEncoding.DecodeString(b64)
+				if err != nil {
+					t.Fatalf("invalid base64 in token %q: %v", token, err)
+				}
+				decoded.Write(raw)
+			}
+
+			if decoded.String() != tt.input {
+				t.Errorf("round-trip mismatch: got %q, want %q", decoded.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestJoinRecipients(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  string
+	}{
+		{
+			name:  "plain addresses",
+			input: []string{"john@example.com", "jane@example.com"},
+			want:  "<john@example.com>,<jane@example.com>",
+		},
+		{
+			name:  "display name without specials",
+			input: []string{"John Doe <john@example.com>"},
+			want:  "John Doe <john@example.com>",
+		},
+		{
+			name:  "display name containing a comma is quoted",
+			input: []string{`"Doe, John" <john@example.com>`, "Jane <jane@example.com>"},
+			want:  `"Doe, John" <john@example.com>,Jane <jane@example.com>`,
+		},
+		{
+			name:  "display name with embedded quote round-trips",
+			input: []string{`"John \"JD\" Doe" <john@example.com>`},
+			want:  `"John \"JD\" Doe" <john@example.com>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := joinRecipients(tt.input)
+			if got != tt.want {
+				t.Errorf("joinRecipients(%v) = %q, want %q", tt.input, got, tt.want)
+			}
+
+			// 結合結果に含まれる '<' の数が入力の宛先数と一致すること、つまり
+			// 引用された表示名中のカンマによって宛先が増えていないことを確認する
+			if want := len(tt.input); strings.Count(got, "<") != want {
+				t.Errorf("got %d address(es) worth of '<' in %q, want %d", strings.Count(got, "<"), got, want)
+			}
+		})
+	}
+}
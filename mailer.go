@@ -0,0 +1,19 @@
+package mail
+
+// Mailer : メール送信方式を抽象化するインタフェース
+// SMTP 以外の送信経路（HTTP API 等）を、mail.Mail を使った同一のAPIで
+// 差し替えられるようにするためのもの
+type Mailer interface {
+	// Send : メールを送信する
+	Send(m *Mail) error
+	// Ping : 送信先との疎通確認を行う
+	Ping(timeout int) error
+}
+
+// インタフェースの実装漏れをコンパイル時に検出する
+var (
+	_ Mailer = (*SMTP)(nil)
+	_ Mailer = (*HTTPMailer)(nil)
+	_ Mailer = (*FileMailer)(nil)
+	_ Mailer = (*LogMailer)(nil)
+)
@@ -0,0 +1,162 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+)
+
+// Session : 1本のSMTP接続を使い回して複数のメールを送信するためのセッション
+// SMTP.Send はメールを送るたびに接続・TLSネゴシエーション・認証をやり直すため、
+// メルマガや通知の一斉送信には不向きである。Session は NewSession で張った接続を
+// Close するまで使い回し、メッセージごとに RSET を発行して再利用する
+type Session struct {
+	smtp   *SMTP
+	client *smtp.Client
+}
+
+// NewSession : SMTPサーバへ接続し、StartTLS/認証まで済ませたSessionを生成する
+func (s *SMTP) NewSession() (*Session, error) {
+	session := &Session{smtp: s}
+	if err := session.connect(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// connect : 接続を張り直し、StartTLS/認証を行う
+// 既存の接続が残っている場合は、張り直す前に閉じてソケットを解放する
+func (session *Session) connect() error {
+	s := session.smtp
+
+	if session.client != nil {
+		session.client.Close()
+		session.client = nil
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	if s.StartTLS && !s.SSL {
+		if err := client.StartTLS(&tls.Config{
+			InsecureSkipVerify: s.Insecure,
+			ServerName:         s.Address,
+		}); err != nil {
+			client.Close()
+			return err
+		}
+	}
+
+	if s.Auth != NoAuth {
+		if s.Username == "" || s.Password == "" {
+			client.Close()
+			return fmt.Errorf("user or password is nil")
+		}
+		if err := client.Auth(s.auth()); err != nil {
+			client.Close()
+			return err
+		}
+	}
+
+	session.client = client
+	return nil
+}
+
+// Send : セッションの接続を使ってメールを送信する
+// isConnectionError が再接続対象と判定したエラー（4xx系、およびtextproto以外のエラー）の場合は
+// 再接続のうえ1度だけ再送する。5xx系のエラーはそのまま返す
+func (session *Session) Send(m *Mail) error {
+	if m == nil {
+		return fmt.Errorf("not mail object")
+	}
+
+	if err := session.send(m); err != nil {
+		if !isConnectionError(err) {
+			return err
+		}
+		if err := session.connect(); err != nil {
+			return err
+		}
+		return session.send(m)
+	}
+
+	return nil
+}
+
+// send : 現在の接続を使って1通分のメールを送信する
+func (session *Session) send(m *Mail) error {
+	client := session.client
+
+	// 送信情報、送信元情報をRcptへ追加する
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	rcpt := append(m.To, append(m.Cc, m.Bcc...)...)
+	for _, v := range rcpt {
+		if err := client.Rcpt(v); err != nil {
+			return err
+		}
+	}
+
+	// メール送信情報を取得
+	header, err := m.Header()
+	if err != nil {
+		return err
+	}
+
+	// メール格納用データを定義
+	writeCloser, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	// 送信内容を書き込む
+	buf := bytes.NewBufferString(header)
+	if _, err := buf.WriteTo(writeCloser); err != nil {
+		writeCloser.Close()
+		return err
+	}
+
+	// DATAの終端(CRLF.CRLF)を送って応答を受け取ってから、次のコマンドへ進む必要がある。
+	// これより前にRSETを発行すると、終端前にコマンドを割り込ませることになりプロトコル違反になる
+	if err := writeCloser.Close(); err != nil {
+		return err
+	}
+
+	// 次のメッセージに備え、トランザクションをリセットする
+	return client.Reset()
+}
+
+// Close : セッションを終了し、接続を閉じる
+func (session *Session) Close() error {
+	if session.client == nil {
+		return nil
+	}
+
+	if err := session.client.Quit(); err != nil {
+		if e, ok := err.(*textproto.Error); ok {
+			if e.Code != 250 || strings.Index(e.Msg, "2.0.0") != 0 {
+				session.client.Close()
+				return err
+			}
+		}
+	}
+
+	return session.client.Close()
+}
+
+// isConnectionError : 再接続すべき接続断エラーかどうかを判定する
+// SMTPの4xx系(一時的エラー)、および *textproto.Error 以外のエラー（ネットワークエラー、Header() の生成エラー等）を対象とする。
+// 5xx系はメールボックス不在など恒久的な拒否であり、接続自体は生きているため再接続の対象にしない
+func isConnectionError(err error) bool {
+	e, ok := err.(*textproto.Error)
+	if !ok {
+		return true
+	}
+	return e.Code >= 400 && e.Code < 500
+}
@@ -0,0 +1,232 @@
+package mail
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// scriptedSMTPServer : Session の再接続/リトライ挙動を検証するための簡易SMTPサーバ
+// 接続（=再接続の試行）ごとに、最初の RCPT TO への応答コードを差し替えられる
+type scriptedSMTPServer struct {
+	ln net.Listener
+
+	mu          sync.Mutex
+	connections int
+	rsetSeen    []bool
+	rcptCodes   []int // index = 接続の通し番号。範囲外は250(成功)を返す
+}
+
+func startScriptedSMTPServer(t *testing.T, rcptCodes []int) (*scriptedSMTPServer, int) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &scriptedSMTPServer{ln: ln, rcptCodes: rcptCodes}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+
+	_, portStr, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("split host port: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parse port: %v", err)
+	}
+
+	return s, port
+}
+
+func (s *scriptedSMTPServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		idx := s.connections
+		s.connections++
+		s.rsetSeen = append(s.rsetSeen, false)
+		s.mu.Unlock()
+
+		go s.handle(conn, idx)
+	}
+}
+
+func (s *scriptedSMTPServer) handle(conn net.Conn, idx int) {
+	defer conn.Close()
+
+	rcptCode := 250
+	if idx < len(s.rcptCodes) {
+		rcptCode = s.rcptCodes[idx]
+	}
+	rcptUsed := false
+
+	writeLine := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	writeLine("220 localhost ESMTP fake")
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		upper := strings.ToUpper(strings.TrimRight(line, "\r\n"))
+
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			writeLine("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM"):
+			writeLine("250 2.1.0 OK")
+		case strings.HasPrefix(upper, "RCPT TO"):
+			if !rcptUsed {
+				rcptUsed = true
+				writeLine(fmt.Sprintf("%d rejected", rcptCode))
+				continue
+			}
+			writeLine("250 2.1.5 OK")
+		case strings.HasPrefix(upper, "DATA"):
+			writeLine("354 go ahead")
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.TrimRight(dataLine, "\r\n") == "." {
+					break
+				}
+			}
+			writeLine("250 2.0.0 OK")
+		case strings.HasPrefix(upper, "RSET"):
+			s.mu.Lock()
+			s.rsetSeen[idx] = true
+			s.mu.Unlock()
+			writeLine("250 2.0.0 OK")
+		case strings.HasPrefix(upper, "QUIT"):
+			writeLine("221 2.0.0 bye")
+			return
+		default:
+			writeLine("250 OK")
+		}
+	}
+}
+
+func (s *scriptedSMTPServer) connectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *scriptedSMTPServer) rsetSeenOn(idx int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return idx < len(s.rsetSeen) && s.rsetSeen[idx]
+}
+
+func testMail() *Mail {
+	return &Mail{
+		From:    "sender@example.com",
+		To:      []string{"rcpt@example.com"},
+		Subject: "hi",
+		Body:    "hello",
+	}
+}
+
+// TestSessionReconnectsOnTransientError : 最初の接続で一時エラー(4xx)を受けた場合、
+// Session が再接続したうえで同じメールを1度だけ再送し、成功として扱うことを確認する
+func TestSessionReconnectsOnTransientError(t *testing.T) {
+	server, port := startScriptedSMTPServer(t, []int{450})
+
+	s := &SMTP{Address: "127.0.0.1", Port: port, Auth: NoAuth}
+	session, err := s.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send(testMail()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := server.connectionCount(); got != 2 {
+		t.Errorf("connectionCount = %d, want 2 (initial connect + reconnect)", got)
+	}
+}
+
+// TestSessionDoesNotRetryOnPermanentError : 5xx(恒久的エラー)は再接続/再送の対象外であり、
+// エラーがそのまま呼び出し元へ返ることを確認する
+func TestSessionDoesNotRetryOnPermanentError(t *testing.T) {
+	server, port := startScriptedSMTPServer(t, []int{550})
+
+	s := &SMTP{Address: "127.0.0.1", Port: port, Auth: NoAuth}
+	session, err := s.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	err = session.Send(testMail())
+	if err == nil {
+		t.Fatal("expected an error for a permanent 5xx rejection")
+	}
+	if !strings.Contains(err.Error(), "550") {
+		t.Errorf("error = %v, want it to mention 550", err)
+	}
+
+	if got := server.connectionCount(); got != 1 {
+		t.Errorf("connectionCount = %d, want 1 (no reconnect on a permanent error)", got)
+	}
+}
+
+// TestSessionResetsBetweenSends : 同一接続で複数回送信した場合、再接続なしに
+// メッセージごとに RSET が発行され、接続が使い回されることを確認する
+func TestSessionResetsBetweenSends(t *testing.T) {
+	server, port := startScriptedSMTPServer(t, nil)
+
+	s := &SMTP{Address: "127.0.0.1", Port: port, Auth: NoAuth}
+	session, err := s.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send(testMail()); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	if err := session.Send(testMail()); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+
+	if got := server.connectionCount(); got != 1 {
+		t.Errorf("connectionCount = %d, want 1 (connection reused across sends)", got)
+	}
+	if !server.rsetSeenOn(0) {
+		t.Errorf("expected RSET to be issued on the shared connection")
+	}
+}
+
+// TestIsConnectionError : 4xx/非textprotoエラーは再接続対象、5xxは対象外と判定することを確認する
+func TestIsConnectionError(t *testing.T) {
+	if !isConnectionError(fmt.Errorf("network is down")) {
+		t.Errorf("a non-textproto error should be treated as a connection error")
+	}
+	if !isConnectionError(&textproto.Error{Code: 450, Msg: "try again later"}) {
+		t.Errorf("a 4xx error should be treated as a connection error")
+	}
+	if isConnectionError(&textproto.Error{Code: 550, Msg: "mailbox unavailable"}) {
+		t.Errorf("a 5xx error should not be treated as a connection error")
+	}
+}